@@ -7,8 +7,12 @@
 package errors
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"net/http"
+	"reflect"
+	"runtime"
 	"strings"
 )
 
@@ -16,6 +20,11 @@ type Error struct {
 	Code Code
 	Op   Op
 	Err  error
+
+	// stack holds the call stack captured at the point E was called,
+	// as returned by runtime.Callers. It is used to print a stack trace
+	// when the error is formatted with the "%+v" verb.
+	stack []uintptr
 }
 
 func (e *Error) Error() string {
@@ -42,6 +51,84 @@ func (e *Error) Unwrap() error {
 	return e.Err
 }
 
+// Is makes e reachable via errors.Is(err, target) when target is the
+// sentinel error matching e.Code, e.g. errors.Is(err, ErrNotFound) for an
+// *Error with Code == NotFound.
+func (e *Error) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.Code == NotFound
+	case ErrAlreadyExists:
+		return e.Code == AlreadyExists
+	case ErrFailedPrecondition:
+		return e.Code == FailedPrecondition
+	case ErrInternal:
+		return e.Code == Internal
+	}
+	return false
+}
+
+// Format implements fmt.Formatter so that callers can opt into a more
+// detailed representation of the error via the "%+v" verb. "%s" and "%v"
+// continue to behave exactly as Error does.
+func (e *Error) Format(s fmt.State, verb rune) {
+	switch verb {
+	case 'v':
+		if s.Flag('+') {
+			fmt.Fprint(s, e.Error())
+			for _, f := range stackTrace(e.stack) {
+				fmt.Fprintf(s, "\n%s\n\t%s:%d", f.Function, f.File, f.Line)
+			}
+			return
+		}
+		fmt.Fprint(s, e.Error())
+	case 's':
+		fmt.Fprint(s, e.Error())
+	}
+}
+
+// maxStackDepth is the maximum number of stack frames captured by E.
+const maxStackDepth = 32
+
+// callers captures the current call stack, skipping the given number of
+// frames in addition to the frames of runtime.Callers, callers and E itself.
+func callers(skip int) []uintptr {
+	var pcs [maxStackDepth]uintptr
+	n := runtime.Callers(skip+3, pcs[:])
+	return pcs[:n]
+}
+
+// stackTrace resolves the given program counters into runtime.Frame values.
+func stackTrace(pcs []uintptr) []runtime.Frame {
+	if len(pcs) == 0 {
+		return nil
+	}
+	frames := runtime.CallersFrames(pcs)
+	var out []runtime.Frame
+	for {
+		frame, more := frames.Next()
+		out = append(out, frame)
+		if !more {
+			break
+		}
+	}
+	return out
+}
+
+// StackTrace returns the deepest call stack captured by errors.E in err's
+// chain, resolved into runtime.Frame values. It returns nil if no captured
+// stack is found in the chain.
+func StackTrace(err error) []runtime.Frame {
+	var deepest []uintptr
+	for err != nil {
+		if e, ok := err.(*Error); ok && len(e.stack) > 0 {
+			deepest = e.stack
+		}
+		err = Unwrap(err)
+	}
+	return stackTrace(deepest)
+}
+
 // Code defines the canonical error code.
 type Code uint8
 
@@ -76,7 +163,7 @@ func (c Code) String() string {
 type Op string
 
 func E(args ...interface{}) error {
-	e := &Error{}
+	e := &Error{stack: callers(0)}
 	for _, arg := range args {
 		switch arg := arg.(type) {
 		case Op:
@@ -85,6 +172,8 @@ func E(args ...interface{}) error {
 			e.Code = arg
 		case error:
 			e.Err = arg
+		case []error:
+			e.Err = Join(arg...)
 		case string:
 			e.Err = errors.New(arg)
 		}
@@ -94,18 +183,110 @@ func E(args ...interface{}) error {
 
 // CanonicalCode returns the canonical code of the given error if one is present.
 // Otherwise it returns Unspecified.
+//
+// Unlike a plain type assertion against *Error, this resolves err's full
+// chain (see Resolve), so a code buried under layers of wrapping is still
+// found, and a TaskNotFoundError or QueueNotFoundError in the chain yields
+// NotFound and a TaskAlreadyArchivedError yields FailedPrecondition.
 func CanonicalCode(err error) Code {
 	if err == nil {
 		return Unspecified
 	}
-	e, ok := err.(*Error)
-	if !ok {
-		return Unspecified
+	return codeOf(Resolve(err))
+}
+
+/******************************************
+    Multi-error support
+*******************************************/
+
+// MultiError is an error that aggregates multiple errors, for example the
+// per-task failures from a batch operation. It implements the Go 1.20
+// multi-unwrap convention (Unwrap() []error) so that Is, As and AsAll all
+// see through it just as they would a single wrapped error.
+type MultiError struct {
+	errs []error
+}
+
+func (e *MultiError) Error() string {
+	msgs := make([]string, len(e.errs))
+	for i, err := range e.errs {
+		msgs[i] = err.Error()
 	}
-	if e.Code == Unspecified {
-		return CanonicalCode(e.Err)
+	return strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the list of errors aggregated by e, as expected by
+// errors.Is, errors.As and AsAll.
+func (e *MultiError) Unwrap() []error {
+	return e.errs
+}
+
+// Join returns an error that aggregates the given non-nil errors into a
+// *MultiError. Nil errors are discarded. Join returns nil if every
+// argument is nil, and returns the lone error itself if only one
+// non-nil error is given.
+//
+// This mirrors the standard library's errors.Join, but returns a
+// *MultiError so that the result formats consistently with errors
+// produced by E.
+func Join(errs ...error) error {
+	var nonNil []error
+	for _, err := range errs {
+		if err != nil {
+			nonNil = append(nonNil, err)
+		}
+	}
+	switch len(nonNil) {
+	case 0:
+		return nil
+	case 1:
+		return nonNil[0]
+	default:
+		return &MultiError{errs: nonNil}
+	}
+}
+
+// markVisited reports whether err was already recorded in seen, recording
+// it if not. Errors whose dynamic type isn't comparable (e.g. a value
+// error wrapping a slice or map) can't be used as a map key, so those are
+// never considered visited; they are simply not deduplicated.
+func markVisited(seen map[error]bool, err error) bool {
+	if !reflect.TypeOf(err).Comparable() {
+		return false
+	}
+	if seen[err] {
+		return true
 	}
-	return e.Code
+	seen[err] = true
+	return false
+}
+
+// AsAll walks err's chain depth-first, following both Unwrap() error and
+// Unwrap() []error, and returns every error whose type matches T. Errors
+// already visited are skipped, so a chain that reaches the same error
+// through more than one path is not double-counted.
+func AsAll[T error](err error) []T {
+	var out []T
+	seen := make(map[error]bool)
+	var walk func(err error)
+	walk = func(err error) {
+		if err == nil || markVisited(seen, err) {
+			return
+		}
+		if t, ok := err.(T); ok {
+			out = append(out, t)
+		}
+		switch x := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, next := range x.Unwrap() {
+				walk(next)
+			}
+		case interface{ Unwrap() error }:
+			walk(x.Unwrap())
+		}
+	}
+	walk(err)
+	return out
 }
 
 /******************************************
@@ -123,6 +304,12 @@ func (e *TaskNotFoundError) Error() string {
 	return fmt.Sprintf("cannot find task with id=%s in queue %q", e.ID, e.Queue)
 }
 
+// Is makes TaskNotFoundError reachable via errors.Is(err, ErrTaskNotFound)
+// and errors.Is(err, ErrNotFound).
+func (e *TaskNotFoundError) Is(target error) bool {
+	return target == ErrTaskNotFound || target == ErrNotFound
+}
+
 // IsTaskNotFound reports whether any error in err's chain is of type TaskNotFoundError.
 func IsTaskNotFound(err error) bool {
 	var target *TaskNotFoundError
@@ -138,6 +325,12 @@ func (e *QueueNotFoundError) Error() string {
 	return fmt.Sprintf("queue %q does not exist", e.Queue)
 }
 
+// Is makes QueueNotFoundError reachable via errors.Is(err, ErrQueueNotFound)
+// and errors.Is(err, ErrNotFound).
+func (e *QueueNotFoundError) Is(target error) bool {
+	return target == ErrQueueNotFound || target == ErrNotFound
+}
+
 // IsQueueNotFound reports whether any error in err's chain is of type QueueNotFoundError.
 func IsQueueNotFound(err error) bool {
 	var target *QueueNotFoundError
@@ -154,12 +347,138 @@ func (e *TaskAlreadyArchivedError) Error() string {
 	return fmt.Sprintf("task is already archived: id=%s, queue=%s", e.ID, e.Queue)
 }
 
+// Is makes TaskAlreadyArchivedError reachable via
+// errors.Is(err, ErrTaskAlreadyArchived) and errors.Is(err, ErrFailedPrecondition).
+func (e *TaskAlreadyArchivedError) Is(target error) bool {
+	return target == ErrTaskAlreadyArchived || target == ErrFailedPrecondition
+}
+
 // IsTaskAlreadyArchived reports whether any error in err's chain is of type TaskAlreadyArchivedError.
 func IsTaskAlreadyArchived(err error) bool {
 	var target *TaskAlreadyArchivedError
 	return As(err, &target)
 }
 
+/******************************************
+    Sentinel errors
+*******************************************/
+
+// Sentinel errors for the domain error types above. Callers can use these
+// with errors.Is(err, asynq.ErrTaskNotFound) instead of this package's
+// IsTaskNotFound/IsQueueNotFound/IsTaskAlreadyArchived helpers.
+var (
+	ErrTaskNotFound        = New("task not found")
+	ErrQueueNotFound       = New("queue not found")
+	ErrTaskAlreadyArchived = New("task already archived")
+)
+
+// Sentinel errors for each canonical Code. (*Error).Is reports a match
+// against the sentinel corresponding to its own Code, so
+// errors.Is(err, asynq.ErrNotFound) works regardless of Op or the
+// wrapped Err.
+var (
+	ErrNotFound           = New("not found")
+	ErrAlreadyExists      = New("already exists")
+	ErrFailedPrecondition = New("failed precondition")
+	ErrInternal           = New("internal error")
+)
+
+/******************************************
+    Canonical error resolution
+*******************************************/
+
+// ErrUnknown is returned by Resolve when no known asynq error type can be
+// found in the given error's chain.
+var ErrUnknown = New("asynq: unknown error")
+
+// Resolve walks err's chain depth-first, following both Unwrap() error
+// and Unwrap() []error, and returns the first error found that is one of
+// asynq's known domain errors: *TaskNotFoundError, *QueueNotFoundError,
+// *TaskAlreadyArchivedError, *Error with a non-Unspecified Code, or
+// context.Canceled/context.DeadlineExceeded. If no such error is found,
+// Resolve returns ErrUnknown.
+//
+// This lets callers translate a possibly deeply wrapped error returned
+// by Client or Inspector into one of asynq's canonical error types,
+// regardless of how many layers of wrapping sit on top of it.
+func Resolve(err error) error {
+	var resolved error
+	seen := make(map[error]bool)
+	var walk func(err error) bool
+	walk = func(err error) bool {
+		if err == nil || markVisited(seen, err) {
+			return false
+		}
+		switch e := err.(type) {
+		case *TaskNotFoundError, *QueueNotFoundError, *TaskAlreadyArchivedError:
+			resolved = e.(error)
+			return true
+		case *Error:
+			if e.Code != Unspecified {
+				resolved = e
+				return true
+			}
+		}
+		if err == context.Canceled || err == context.DeadlineExceeded {
+			resolved = err
+			return true
+		}
+		switch x := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, next := range x.Unwrap() {
+				if walk(next) {
+					return true
+				}
+			}
+			return false
+		case interface{ Unwrap() error }:
+			return walk(x.Unwrap())
+		}
+		return false
+	}
+	if walk(err) {
+		return resolved
+	}
+	return ErrUnknown
+}
+
+// codeOf returns the canonical Code for a resolved error, i.e. one
+// returned by Resolve. It returns Unspecified for errors that don't map
+// to one of the canonical codes, such as ErrUnknown or a context error.
+func codeOf(err error) Code {
+	switch e := err.(type) {
+	case *TaskNotFoundError, *QueueNotFoundError:
+		return NotFound
+	case *TaskAlreadyArchivedError:
+		return FailedPrecondition
+	case *Error:
+		return e.Code
+	}
+	return Unspecified
+}
+
+// HTTPStatus returns the HTTP status code corresponding to err, resolved
+// via Resolve. It returns http.StatusInternalServerError if err does not
+// resolve to one of asynq's canonical error codes.
+func HTTPStatus(err error) int {
+	switch codeOf(Resolve(err)) {
+	case NotFound:
+		return http.StatusNotFound
+	case AlreadyExists:
+		return http.StatusConflict
+	case FailedPrecondition:
+		return http.StatusPreconditionFailed
+	case Internal:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// gRPC status code mapping lives in the optional errors/grpc subpackage,
+// built on top of CanonicalCode, so that depending on asynq's core error
+// types doesn't drag a gRPC dependency into every consumer of this package.
+
 /*************************************************
     Standard Library errors package functions
 *************************************************/
@@ -0,0 +1,258 @@
+// Copyright 2020 Kentaro Hibino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package errors
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestErrorFormat(t *testing.T) {
+	err := E(Op("rdb.Enqueue"), NotFound, "task not found")
+
+	if got, want := fmt.Sprintf("%v", err), "rdb.Enqueue: NOT_FOUND: task not found"; got != want {
+		t.Errorf("%%v: got %q, want %q", got, want)
+	}
+	if got, want := fmt.Sprintf("%s", err), fmt.Sprintf("%v", err); got != want {
+		t.Errorf("%%s and %%v should match: got %q, want %q", got, want)
+	}
+
+	plus := fmt.Sprintf("%+v", err)
+	if !strings.HasPrefix(plus, err.Error()) {
+		t.Errorf("%%+v should start with Error(): got %q", plus)
+	}
+	if !strings.Contains(plus, "TestErrorFormat") {
+		t.Errorf("%%+v should include a stack frame naming the caller of E: got %q", plus)
+	}
+	if strings.Contains(plus, "errors.E\n") {
+		t.Errorf("%%+v should skip the E frame itself: got %q", plus)
+	}
+}
+
+func innerE() error {
+	return E(Op("inner"), "boom")
+}
+
+func TestStackTrace(t *testing.T) {
+	err := innerE()
+
+	frames := StackTrace(err)
+	if len(frames) == 0 {
+		t.Fatal("StackTrace returned no frames")
+	}
+	if got := frames[0].Function; !strings.HasSuffix(got, "innerE") {
+		t.Errorf("deepest frame should be innerE, got %q", got)
+	}
+	for _, f := range frames {
+		if strings.HasSuffix(f.Function, ".E") {
+			t.Errorf("StackTrace should skip the E frame, found %q", f.Function)
+		}
+	}
+
+	// Wrapping the error in another *Error shouldn't change which stack
+	// is reported: the deepest captured stack wins.
+	wrapped := E(Op("outer"), err)
+	if got, want := StackTrace(wrapped), frames; len(got) != len(want) {
+		t.Errorf("StackTrace(wrapped) has %d frames, want %d", len(got), len(want))
+	}
+
+	if frames := StackTrace(New("plain")); frames != nil {
+		t.Errorf("StackTrace of an error with no captured stack should be nil, got %v", frames)
+	}
+}
+
+func TestJoin(t *testing.T) {
+	e1 := New("e1")
+	e2 := New("e2")
+
+	if got := Join(); got != nil {
+		t.Errorf("Join() = %v, want nil", got)
+	}
+	if got := Join(nil, nil); got != nil {
+		t.Errorf("Join(nil, nil) = %v, want nil", got)
+	}
+	if got := Join(e1, nil); got != e1 {
+		t.Errorf("Join(e1, nil) = %v, want %v", got, e1)
+	}
+
+	joined := Join(e1, e2)
+	me, ok := joined.(*MultiError)
+	if !ok {
+		t.Fatalf("Join(e1, e2) = %T, want *MultiError", joined)
+	}
+	if got, want := me.Error(), "e1; e2"; got != want {
+		t.Errorf("MultiError.Error() = %q, want %q", got, want)
+	}
+	if got := me.Unwrap(); len(got) != 2 || got[0] != e1 || got[1] != e2 {
+		t.Errorf("MultiError.Unwrap() = %v, want [%v %v]", got, e1, e2)
+	}
+	if !Is(joined, e1) || !Is(joined, e2) {
+		t.Errorf("errors.Is should see through MultiError to both e1 and e2")
+	}
+}
+
+func TestAsAll(t *testing.T) {
+	tnf1 := &TaskNotFoundError{Queue: "default", ID: "1"}
+	tnf2 := &TaskNotFoundError{Queue: "default", ID: "2"}
+	joined := Join(tnf1, tnf2, New("unrelated"))
+
+	got := AsAll[*TaskNotFoundError](joined)
+	if len(got) != 2 || got[0] != tnf1 || got[1] != tnf2 {
+		t.Errorf("AsAll[*TaskNotFoundError](joined) = %v, want [%v %v]", got, tnf1, tnf2)
+	}
+
+	// The same error reachable through two paths is only returned once.
+	shared := Join(tnf1, tnf1)
+	if got := AsAll[*TaskNotFoundError](shared); len(got) != 1 {
+		t.Errorf("AsAll should dedup a repeated pointer, got %v", got)
+	}
+
+	// An uncomparable dynamic type (e.g. wrapping a slice) must not panic
+	// when used in AsAll's internal dedup.
+	uncomparable := E(Op("x"), uncomparableError{vals: []int{1, 2, 3}})
+	if got := AsAll[*TaskNotFoundError](uncomparable); len(got) != 0 {
+		t.Errorf("AsAll with an uncomparable error in the chain = %v, want empty", got)
+	}
+}
+
+// uncomparableError is an error type with a slice field, making values of
+// this type unusable as a map key (a regression check for AsAll/Resolve).
+type uncomparableError struct {
+	vals []int
+}
+
+func (e uncomparableError) Error() string {
+	return fmt.Sprintf("uncomparable: %v", e.vals)
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"nil", nil, ErrUnknown},
+		{"task not found", &TaskNotFoundError{Queue: "default", ID: "1"}, nil},
+		{"wrapped code", E(Op("rdb.Enqueue"), Internal, "boom"), nil},
+		{"context canceled", E(Op("x"), context.Canceled), context.Canceled},
+		{"no known error", New("plain"), ErrUnknown},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got := Resolve(tc.err)
+			if tc.want != nil && got != tc.want {
+				t.Errorf("Resolve(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+			if tc.name == "task not found" {
+				if _, ok := got.(*TaskNotFoundError); !ok {
+					t.Errorf("Resolve(%v) = %T, want *TaskNotFoundError", tc.err, got)
+				}
+			}
+			if tc.name == "wrapped code" {
+				e, ok := got.(*Error)
+				if !ok || e.Code != Internal {
+					t.Errorf("Resolve(%v) = %v, want an *Error with Code Internal", tc.err, got)
+				}
+			}
+		})
+	}
+
+	// Resolve must not panic when the chain contains an uncomparable
+	// dynamic type.
+	err := E(Op("x"), uncomparableError{vals: []int{1, 2}})
+	if got := Resolve(err); got != ErrUnknown {
+		t.Errorf("Resolve with an uncomparable error in the chain = %v, want ErrUnknown", got)
+	}
+}
+
+func TestCanonicalCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want Code
+	}{
+		{"nil", nil, Unspecified},
+		{"direct code", E(NotFound, "task not found"), NotFound},
+		{"wrapped in op", E(Op("rdb.Enqueue"), E(Internal, "boom")), Internal},
+		{"task not found type", &TaskNotFoundError{Queue: "default", ID: "1"}, NotFound},
+		{"task already archived type", &TaskAlreadyArchivedError{Queue: "default", ID: "1"}, FailedPrecondition},
+		{"no code", New("plain"), Unspecified},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := CanonicalCode(tc.err); got != tc.want {
+				t.Errorf("CanonicalCode(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestHTTPStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"not found", &TaskNotFoundError{Queue: "default", ID: "1"}, http.StatusNotFound},
+		{"already exists", E(AlreadyExists, "dup"), http.StatusConflict},
+		{"failed precondition", &TaskAlreadyArchivedError{Queue: "default", ID: "1"}, http.StatusPreconditionFailed},
+		{"internal", E(Internal, "boom"), http.StatusInternalServerError},
+		{"unknown", New("plain"), http.StatusInternalServerError},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := HTTPStatus(tc.err); got != tc.want {
+				t.Errorf("HTTPStatus(%v) = %d, want %d", tc.err, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDomainErrorIs(t *testing.T) {
+	tnf := &TaskNotFoundError{Queue: "default", ID: "1"}
+	if !Is(tnf, ErrTaskNotFound) {
+		t.Error("Is(tnf, ErrTaskNotFound) = false, want true")
+	}
+	if !Is(tnf, ErrNotFound) {
+		t.Error("Is(tnf, ErrNotFound) = false, want true")
+	}
+	if Is(tnf, ErrQueueNotFound) {
+		t.Error("Is(tnf, ErrQueueNotFound) = true, want false")
+	}
+
+	qnf := &QueueNotFoundError{Queue: "default"}
+	if !Is(qnf, ErrQueueNotFound) || !Is(qnf, ErrNotFound) {
+		t.Error("QueueNotFoundError should match ErrQueueNotFound and ErrNotFound")
+	}
+
+	taa := &TaskAlreadyArchivedError{Queue: "default", ID: "1"}
+	if !Is(taa, ErrTaskAlreadyArchived) || !Is(taa, ErrFailedPrecondition) {
+		t.Error("TaskAlreadyArchivedError should match ErrTaskAlreadyArchived and ErrFailedPrecondition")
+	}
+}
+
+func TestErrorIsByCode(t *testing.T) {
+	tests := []struct {
+		code   Code
+		target error
+	}{
+		{NotFound, ErrNotFound},
+		{AlreadyExists, ErrAlreadyExists},
+		{FailedPrecondition, ErrFailedPrecondition},
+		{Internal, ErrInternal},
+	}
+	for _, tc := range tests {
+		err := E(tc.code, "boom")
+		if !Is(err, tc.target) {
+			t.Errorf("E(%v) should match sentinel %v", tc.code, tc.target)
+		}
+		if Is(err, ErrTaskNotFound) {
+			t.Errorf("E(%v) should not match unrelated sentinel ErrTaskNotFound", tc.code)
+		}
+	}
+}
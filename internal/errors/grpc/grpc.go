@@ -0,0 +1,34 @@
+// Copyright 2020 Kentaro Hibino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+// Package grpc maps asynq's canonical error codes to gRPC status codes.
+//
+// This lives in its own subpackage, rather than in errors itself, so that
+// pulling in google.golang.org/grpc is opt-in: only callers that need to
+// translate errors for a gRPC handler take on that dependency.
+package grpc
+
+import (
+	"google.golang.org/grpc/codes"
+
+	"github.com/hibiken/asynq/internal/errors"
+)
+
+// Code returns the gRPC status code corresponding to err, resolved via
+// errors.CanonicalCode. It returns codes.Unknown if err does not resolve
+// to one of asynq's canonical error codes.
+func Code(err error) codes.Code {
+	switch errors.CanonicalCode(err) {
+	case errors.NotFound:
+		return codes.NotFound
+	case errors.AlreadyExists:
+		return codes.AlreadyExists
+	case errors.FailedPrecondition:
+		return codes.FailedPrecondition
+	case errors.Internal:
+		return codes.Internal
+	default:
+		return codes.Unknown
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2020 Kentaro Hibino. All rights reserved.
+// Use of this source code is governed by a MIT license
+// that can be found in the LICENSE file.
+
+package grpc
+
+import (
+	"testing"
+
+	"google.golang.org/grpc/codes"
+
+	"github.com/hibiken/asynq/internal/errors"
+)
+
+func TestCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want codes.Code
+	}{
+		{"not found", &errors.TaskNotFoundError{Queue: "default", ID: "1"}, codes.NotFound},
+		{"already exists", errors.E(errors.AlreadyExists, "dup"), codes.AlreadyExists},
+		{"failed precondition", &errors.TaskAlreadyArchivedError{Queue: "default", ID: "1"}, codes.FailedPrecondition},
+		{"internal", errors.E(errors.Internal, "boom"), codes.Internal},
+		{"unknown", errors.New("plain"), codes.Unknown},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := Code(tc.err); got != tc.want {
+				t.Errorf("Code(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}